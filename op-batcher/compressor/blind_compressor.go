@@ -2,8 +2,6 @@ package compressor
 
 import (
 	"bytes"
-	"compress/zlib"
-	"fmt"
 
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 )
@@ -16,17 +14,18 @@ type BlindCompressor struct {
 
 	inputBytes int
 	buf        bytes.Buffer
-	compress   *zlib.Writer
+	compress   derive.CompressorAlgo
 	buildbuf   []byte
 }
 
 // NewBlindCompressor creates a new derive.Compressor implementation that compresses
+// using config.Algorithm (AlgoZlib if unset).
 func NewBlindCompressor(config Config) (derive.Compressor, error) {
 	c := &BlindCompressor{
 		config: config,
 	}
 
-	compress, err := zlib.NewWriterLevel(&c.buf, zlib.BestCompression)
+	compress, err := derive.NewCompressorAlgo(config.Algorithm, &c.buf)
 	if err != nil {
 		return nil, err
 	}
@@ -47,19 +46,33 @@ func (t *BlindCompressor) Write(p []byte) (int, error) {
 	// if the buffer plus the already compressed data is under the target size, return
 	// once enough data has been written, the buffer will be flushed and compressed
 	if uint64(len(t.buildbuf)+t.buf.Len()) < t.config.TargetOutputSize {
-		fmt.Println("returning early")
 		return len(p), nil
 	}
 	if err := t.FullErr(); err != nil {
 		return 0, err
 	}
 	t.inputBytes += len(p)
+	// buildbuf holds everything accumulated since the last compress.Write, not just p: on an
+	// early-return call p alone was never written to compress, so writing only p here would
+	// silently drop it from the compressed output.
+	buf := t.buildbuf
 	t.buildbuf = nil
-	fmt.Println("compressing")
-	return t.compress.Write(p)
+	if _, err := t.compress.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
 func (t *BlindCompressor) Close() error {
+	// Anything still in buildbuf never crossed TargetOutputSize and so was never written to
+	// compress; without writing it here it would be silently dropped from the output.
+	if len(t.buildbuf) > 0 {
+		buf := t.buildbuf
+		t.buildbuf = nil
+		if _, err := t.compress.Write(buf); err != nil {
+			return err
+		}
+	}
 	return t.compress.Close()
 }
 
@@ -69,7 +82,9 @@ func (t *BlindCompressor) Read(p []byte) (int, error) {
 
 func (t *BlindCompressor) Reset() {
 	t.buf.Reset()
-	t.compress.Reset(&t.buf)
+	// the underlying buffer is always empty immediately after Reset, so none of our
+	// supported algorithms can fail here
+	_ = t.compress.Reset(&t.buf)
 	t.inputBytes = 0
 }
 
@@ -0,0 +1,44 @@
+package compressor
+
+import (
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// Config holds the configuration for a Compressor.
+type Config struct {
+	// TargetOutputSize is the target size, in bytes, of the compressed output.
+	TargetOutputSize uint64
+
+	// ApproxComprRatio is the expected compression ratio, used by compressors that
+	// estimate compressed size from uncompressed input size rather than compressing
+	// eagerly.
+	ApproxComprRatio float64
+
+	// Algorithm selects the compression algorithm backing the Compressor. It defaults
+	// to derive.AlgoZlib, which matches the channel framing every existing op-node
+	// deployment already decodes.
+	Algorithm derive.CompressionAlgo
+
+	// ZstdEncoderLevel overrides the zstd encoder level used by ZstdCompressor. Defaults to
+	// zstd.SpeedBestCompression when unset. It does not apply to Algorithm ==
+	// derive.AlgoZstd, which always encodes at zstd.SpeedBestCompression.
+	ZstdEncoderLevel zstd.EncoderLevel
+
+	// ZstdDictionary, if set, is used as a shared zstd dictionary. Batches are similarly
+	// shaped RLP across a chain, so a trained dictionary meaningfully improves ratio on
+	// otherwise-small batches.
+	ZstdDictionary []byte
+
+	// ZstdEncoderConcurrency overrides the number of goroutines zstd uses to encode
+	// (zstd.WithEncoderConcurrency). Defaults to the library's own GOMAXPROCS-based pick.
+	ZstdEncoderConcurrency int
+
+	// AlgorithmActivationTime is the L1 block-timestamp-unit hard fork time at which
+	// Algorithm (if not derive.AlgoZlib) becomes valid to write, following the
+	// rollup.Config convention of *uint64 fork times (e.g. CanyonTime, DeltaTime). A nil
+	// value means Algorithm has no scheduled activation and is never usable. See
+	// NewSpanChannelOut, which enforces this via derive.ValidateAlgoActivation.
+	AlgorithmActivationTime *uint64
+}
@@ -0,0 +1,164 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// ParallelShadowCompressor is an opt-in alternative to ShadowCompressor for large span
+// batches: on Close it splits the buffered input into shards (one per GOMAXPROCS by
+// default) and zlib-compresses each shard concurrently, concatenating the results behind a
+// small framing header. Because sharded compression cannot see across shard boundaries it
+// compresses somewhat worse than a single serial stream, so TargetOutputSize is still
+// enforced against a serial ShadowCompressor's estimate of the same input, not against the
+// sharded output - the caller gets the parallelism without a channel quietly overshooting
+// its target size.
+//
+// This is a benchmark-only compressor: its parallelShardFrameMagic framing is not decodable
+// by op-node's derivation pipeline, which only understands a single compressed stream per
+// channel. Do not construct a channel for submission to L1 with this Compressor; it exists
+// to measure whether sharded compression is worth building a real, decodable framing for.
+type ParallelShadowCompressor struct {
+	config Config
+	shards int
+
+	// estimate tracks the serial (unsharded) compressed size of everything written so
+	// far, purely to enforce TargetOutputSize the same way ShadowCompressor does.
+	estimate derive.Compressor
+
+	raw bytes.Buffer // buffered, uncompressed input
+	out bytes.Buffer // framed, sharded output, populated by Close
+}
+
+// parallelShardFrameMagic distinguishes ParallelShadowCompressor's output from a plain
+// zlib stream so a decoder can tell which framing to expect.
+const parallelShardFrameMagic = "PSC1"
+
+// NewParallelShadowCompressor creates a ParallelShadowCompressor. shards is the number of
+// independently-compressed shards produced on Close; 0 defaults to runtime.GOMAXPROCS(0).
+// Benchmark-only: see the ParallelShadowCompressor doc comment.
+func NewParallelShadowCompressor(config Config, shards int) (derive.Compressor, error) {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	estimate, err := NewShadowCompressor(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating shadow estimator: %w", err)
+	}
+	return &ParallelShadowCompressor{config: config, shards: shards, estimate: estimate}, nil
+}
+
+func (p *ParallelShadowCompressor) TargetOutputSize() uint64 {
+	return p.config.TargetOutputSize
+}
+
+func (p *ParallelShadowCompressor) Write(data []byte) (int, error) {
+	if _, err := p.estimate.Write(data); err != nil {
+		return 0, err
+	}
+	p.raw.Write(data)
+	return len(data), nil
+}
+
+func (p *ParallelShadowCompressor) FullErr() error {
+	return p.estimate.FullErr()
+}
+
+func (p *ParallelShadowCompressor) Flush() error {
+	return p.estimate.Flush()
+}
+
+func (p *ParallelShadowCompressor) Len() int {
+	return p.out.Len()
+}
+
+func (p *ParallelShadowCompressor) Read(b []byte) (int, error) {
+	return p.out.Read(b)
+}
+
+func (p *ParallelShadowCompressor) Reset() {
+	p.estimate.Reset()
+	p.raw.Reset()
+	p.out.Reset()
+}
+
+// Close shards the buffered input, compresses each shard concurrently, and assembles the
+// framed output: a magic prefix, a shard count, and a (4-byte length, compressed bytes)
+// pair per shard.
+func (p *ParallelShadowCompressor) Close() error {
+	if err := p.estimate.Close(); err != nil {
+		return err
+	}
+
+	shards := shardInput(p.raw.Bytes(), p.shards)
+	compressed := make([][]byte, len(shards))
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(shards))
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard []byte) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			w, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if _, err := w.Write(shard); err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = w.Close()
+			compressed[i] = buf.Bytes()
+		}(i, shard)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	p.out.Reset()
+	p.out.WriteString(parallelShardFrameMagic)
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(compressed)))
+	p.out.Write(lenBuf[:])
+	for _, shard := range compressed {
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(shard)))
+		p.out.Write(lenBuf[:])
+		p.out.Write(shard)
+	}
+	return nil
+}
+
+// shardInput splits data into up to n contiguous, roughly equal shards. It never returns
+// more shards than data has bytes.
+func shardInput(data []byte, n int) [][]byte {
+	if n < 1 {
+		n = 1
+	}
+	if n > len(data) {
+		n = len(data)
+	}
+	if n == 0 {
+		return nil
+	}
+	shardSize := (len(data) + n - 1) / n
+	shards := make([][]byte, 0, n)
+	for start := 0; start < len(data); start += shardSize {
+		end := start + shardSize
+		if end > len(data) {
+			end = len(data)
+		}
+		shards = append(shards, data[start:end])
+	}
+	return shards
+}
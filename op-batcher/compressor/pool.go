@@ -0,0 +1,47 @@
+package compressor
+
+import (
+	"sync"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// Pool is a sync.Pool of derive.Compressor instances, avoiding the re-initialization cost
+// of a fresh Shadow/Ratio/zstd writer every time a ChannelOut is built. The cost is
+// significant at high channel turnover, since constructing a compressor means allocating
+// and priming its underlying writer's internal tables/window.
+//
+// Callers must not retain a Compressor obtained from Get after calling Put with it: Put
+// resets it, and a later Get may hand the same instance to a different caller.
+type Pool struct {
+	pool sync.Pool
+}
+
+// NewPool creates a Pool that builds new Compressors with newCompressor when empty.
+// newCompressor is expected to only fail on misconfiguration - the same misconfiguration
+// that would fail the caller's own first, un-pooled construction - so Pool panics rather
+// than thread an error through sync.Pool.New, which has no error return.
+func NewPool(newCompressor func() (derive.Compressor, error)) *Pool {
+	return &Pool{
+		pool: sync.Pool{
+			New: func() any {
+				c, err := newCompressor()
+				if err != nil {
+					panic(err)
+				}
+				return c
+			},
+		},
+	}
+}
+
+// Get borrows a Compressor from the pool, building one if the pool is empty.
+func (p *Pool) Get() derive.Compressor {
+	return p.pool.Get().(derive.Compressor)
+}
+
+// Put resets c and returns it to the pool for reuse.
+func (p *Pool) Put(c derive.Compressor) {
+	c.Reset()
+	p.pool.Put(c)
+}
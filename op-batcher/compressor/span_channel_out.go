@@ -0,0 +1,19 @@
+package compressor
+
+import (
+	"math/big"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// NewSpanChannelOut is the op-batcher's entry point for constructing a span-batch channel:
+// it validates config.Algorithm against l1BlockTime and config.AlgorithmActivationTime via
+// derive.ValidateAlgoActivation before delegating to
+// derive.NewSpanChannelOutWithAlgoActivation, so the batcher can never start writing a
+// channel with an algorithm the network's derivation pipeline isn't yet upgraded to accept.
+// Callers must pass the L1 origin block time of the channel they are about to build, not a
+// config-time constant, since activation is judged against each channel's actual position in
+// L1 time.
+func NewSpanChannelOut(config Config, genesisTimestamp uint64, chainID *big.Int, l1BlockTime uint64) (*derive.SpanChannelOut, error) {
+	return derive.NewSpanChannelOutWithAlgoActivation(genesisTimestamp, chainID, config.TargetOutputSize, config.Algorithm, l1BlockTime, config.AlgorithmActivationTime)
+}
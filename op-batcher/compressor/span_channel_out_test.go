@@ -0,0 +1,32 @@
+package compressor
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpanChannelOutRejectsUnactivatedAlgorithm(t *testing.T) {
+	activation := uint64(1000)
+	config := Config{
+		TargetOutputSize:        100_000,
+		Algorithm:               derive.AlgoZstd,
+		AlgorithmActivationTime: &activation,
+	}
+
+	_, err := NewSpanChannelOut(config, 0, big.NewInt(1), activation-1)
+	require.ErrorIs(t, err, derive.ErrAlgoNotActivated)
+
+	co, err := NewSpanChannelOut(config, 0, big.NewInt(1), activation)
+	require.NoError(t, err)
+	require.NotNil(t, co)
+}
+
+func TestNewSpanChannelOutAlwaysAllowsZlib(t *testing.T) {
+	config := Config{TargetOutputSize: 100_000, Algorithm: derive.AlgoZlib}
+	co, err := NewSpanChannelOut(config, 0, big.NewInt(1), 0)
+	require.NoError(t, err)
+	require.NotNil(t, co)
+}
@@ -0,0 +1,120 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// ZstdCompressor is a Compressor that, like BlindCompressor, blindly compresses data: the
+// only way to know the target size has been reached is to flush the encoder and check the
+// length of the compressed data. Unlike BlindCompressor it always encodes with zstd, and
+// exposes the zstd-specific tuning knobs - encoder level, a shared dictionary, and encoder
+// concurrency - that setting Config.Algorithm to derive.AlgoZstd alone does not.
+type ZstdCompressor struct {
+	config Config
+
+	inputBytes int
+	buf        bytes.Buffer
+	compress   *zstd.Encoder
+	buildbuf   []byte
+}
+
+// NewZstdCompressor creates a new derive.Compressor implementation that compresses with
+// zstd, honoring config.ZstdEncoderLevel, config.ZstdDictionary, and
+// config.ZstdEncoderConcurrency where set.
+func NewZstdCompressor(config Config) (derive.Compressor, error) {
+	t := &ZstdCompressor{config: config}
+
+	level := config.ZstdEncoderLevel
+	if level == 0 {
+		level = zstd.SpeedBestCompression
+	}
+	opts := []zstd.EOption{zstd.WithEncoderLevel(level)}
+	if len(config.ZstdDictionary) > 0 {
+		opts = append(opts, zstd.WithEncoderDict(config.ZstdDictionary))
+	}
+	if config.ZstdEncoderConcurrency > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(config.ZstdEncoderConcurrency))
+	}
+
+	compress, err := zstd.NewWriter(&t.buf, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating zstd encoder: %w", err)
+	}
+	t.compress = compress
+
+	return t, nil
+}
+
+func (t *ZstdCompressor) TargetOutputSize() uint64 {
+	return t.config.TargetOutputSize
+}
+
+func (t *ZstdCompressor) Write(p []byte) (int, error) {
+	// always start by flushing for an accurate size of compressed data
+	t.compress.Flush()
+	// grow the building buffer with the new input
+	t.buildbuf = append(t.buildbuf, p...)
+	// if the buffer plus the already compressed data is under the target size, return
+	// once enough data has been written, the buffer will be flushed and compressed
+	if uint64(len(t.buildbuf)+t.buf.Len()) < t.config.TargetOutputSize {
+		return len(p), nil
+	}
+	if err := t.FullErr(); err != nil {
+		return 0, err
+	}
+	t.inputBytes += len(p)
+	// buildbuf holds everything accumulated since the last compress.Write, not just p: on an
+	// early-return call p alone was never written to compress, so writing only p here would
+	// silently drop it from the compressed output.
+	buf := t.buildbuf
+	t.buildbuf = nil
+	if _, err := t.compress.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *ZstdCompressor) Close() error {
+	// Anything still in buildbuf never crossed TargetOutputSize and so was never written to
+	// compress; without writing it here it would be silently dropped from the output.
+	if len(t.buildbuf) > 0 {
+		buf := t.buildbuf
+		t.buildbuf = nil
+		if _, err := t.compress.Write(buf); err != nil {
+			return err
+		}
+	}
+	return t.compress.Close()
+}
+
+func (t *ZstdCompressor) Read(p []byte) (int, error) {
+	return t.buf.Read(p)
+}
+
+func (t *ZstdCompressor) Reset() {
+	t.buf.Reset()
+	t.compress.Reset(&t.buf)
+	t.inputBytes = 0
+}
+
+func (t *ZstdCompressor) Len() int {
+	return t.buf.Len()
+}
+
+func (t *ZstdCompressor) Flush() error {
+	return t.compress.Flush()
+}
+
+// FullErr returns an error if the target output size has been reached.
+// Flush *must* be called before this method to ensure the buffer is up to date
+func (t *ZstdCompressor) FullErr() error {
+	if uint64(t.Len()) >= t.config.TargetOutputSize {
+		return derive.ErrCompressorFull
+	}
+	return nil
+}
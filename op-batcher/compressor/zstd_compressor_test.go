@@ -0,0 +1,22 @@
+package compressor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestZstdCompressorFlushesOnClose verifies that input written below TargetOutputSize -
+// which Write only buffers in buildbuf rather than handing to the encoder - is not lost when
+// Close is called before the buffer ever crosses the target.
+func TestZstdCompressorFlushesOnClose(t *testing.T) {
+	c, err := NewZstdCompressor(Config{TargetOutputSize: 100_000_000_000})
+	require.NoError(t, err)
+
+	input := []byte("some span batch rlp bytes that never reach the target size")
+	_, err = c.Write(input)
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	require.Greater(t, c.Len(), 0, "Close must flush buildbuf into the encoder")
+}
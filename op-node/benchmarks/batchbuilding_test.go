@@ -1,12 +1,17 @@
 package benchmarks
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
+	"runtime"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/rlp"
+
 	"github.com/ethereum-optimism/optimism/op-batcher/compressor"
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
 	"github.com/stretchr/testify/require"
@@ -28,6 +33,9 @@ var (
 	bc, _ = compressor.NewBlindCompressor(compressor.Config{
 		TargetOutputSize: 100_000_000_000,
 	})
+	zc, _ = compressor.NewZstdCompressor(compressor.Config{
+		TargetOutputSize: 100_000_000_000,
+	})
 	realc, _ = compressor.NewShadowCompressor(compressor.Config{
 		// this target size was determiend by the devnet sepolia batcher's configuration
 		TargetOutputSize: 780120,
@@ -38,6 +46,7 @@ var (
 		"NonCompressor":    nc,
 		"RatioCompressor":  rc,
 		"ShadowCompressor": sc,
+		"ZstdCompressor":   zc,
 		"RealCompressor":   realc,
 	}
 
@@ -133,50 +142,52 @@ func BenchmarkFinalBatchChannelOut(b *testing.B) {
 	}
 }
 
-// BenchmarkIncremental fills a channel out incrementally with batches
-// each increment is counted as its own benchmark
-// Hint: use -benchtime=1x to run the benchmarks for a single iteration
-// it is not currently designed to use b.N
+// BenchmarkIncremental fills a channel out to its target size under RealCompressor, one
+// cycle per b.N, stopping a cycle only on ErrCompressorFull or ErrTooManyRLPBytes (any
+// other error is a benchmark failure, not a full channel). Each cycle reports the
+// compression ratio achieved and the number of batches packed before the channel closed,
+// giving batcher operators a reproducible answer to "how many txs fit in one
+// 780_120-byte channel under ShadowCompressor" across code changes.
+// Hint: use -benchtime=Nx to control the number of fill-to-full cycles run.
 func BenchmarkIncremental(b *testing.B) {
 	chainID := big.NewInt(333)
 	rng := rand.New(rand.NewSource(0x543331))
-	// use the real compressor for this benchmark
-	// use batchCount as the number of batches to add in each benchmark iteration
-	// and use txPerBatch as the number of transactions per batch
-	tcs := []BatchingBenchmarkTC{
-		{derive.SpanBatchType, 100, 1, ""},
-		//{derive.SingularBatchType, 100, 1, ""},
-	}
-	for _, tc := range tcs {
-		cout, err := derive.NewChannelOut(tc.BatchType, compressors["RealCompressor"], derive.NewSpanBatch(0, chainID))
-		if err != nil {
-			b.Fatal(err)
-		}
-		done := false
-		for base := 0; !done; base += tc.BatchCount {
-			rangeName := fmt.Sprintf("Incremental %s: %d-%d", tc.String(), base, base+tc.BatchCount)
-			b.Run(rangeName, func(b *testing.B) {
-				b.StopTimer()
-				// prepare the batches
-				t := time.Now()
-				batches := make([]*derive.SingularBatch, tc.BatchCount)
-				for i := 0; i < tc.BatchCount; i++ {
-					t := t.Add(time.Second)
-					batches[i] = derive.RandomSingularBatch(rng, tc.txPerBatch, chainID)
-					// set the timestamp to increase with each batch
-					// to leverage optimizations in the Batch Linked List
-					batches[i].Timestamp = uint64(t.Unix())
-				}
-				b.StartTimer()
-				for i := 0; i < tc.BatchCount; i++ {
-					_, err := cout.AddSingularBatch(batches[i], 0)
-					if err != nil {
-						done = true
-						return
-					}
+	const txPerBatch = 1
+
+	for cycle := 0; cycle < b.N; cycle++ {
+		compressors["RealCompressor"].Reset()
+		cout, err := derive.NewChannelOut(derive.SpanBatchType, compressors["RealCompressor"], derive.NewSpanBatch(0, chainID))
+		require.NoError(b, err)
+
+		start := time.Now()
+		var batchesPacked int
+		for {
+			batch := derive.RandomSingularBatch(rng, txPerBatch, chainID)
+			// set the timestamp to increase with each batch to leverage optimizations in
+			// the Batch Linked List
+			batch.Timestamp = uint64(start.Add(time.Duration(batchesPacked) * time.Second).Unix())
+
+			_, err := cout.AddSingularBatch(batch, 0)
+			if err != nil {
+				if errors.Is(err, derive.ErrCompressorFull) || errors.Is(err, derive.ErrTooManyRLPBytes) {
+					break
 				}
-			})
+				require.NoError(b, err)
+			}
+			batchesPacked++
+		}
+		if err := cout.Close(); err != nil && !errors.Is(err, derive.ErrChannelOutAlreadyClosed) {
+			require.NoError(b, err)
 		}
+
+		// AddSingularBatch's return value is in compressed bytes on the path that triggers a
+		// compress, but in uncompressed RLP bytes on the early-return path - using it
+		// directly as the ratio numerator mixes units depending on which path the last call
+		// happened to take. cout.InputBytes() always reports uncompressed RLP bytes. After an
+		// ErrCompressorFull rollback it still counts the RLP of the rejected final batch, so
+		// the reported ratio includes that batch's bytes in its numerator.
+		b.ReportMetric(float64(cout.InputBytes())/float64(cout.ReadyBytes()), "ratio")
+		b.ReportMetric(float64(batchesPacked), "batches")
 	}
 }
 
@@ -287,3 +298,142 @@ func BenchmarkGetRawSpanBatch(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkParallelShadowCompressor compares ShadowCompressor's single-threaded zlib
+// writer against ParallelShadowCompressor's sharded, concurrent one, across a range of
+// GOMAXPROCS settings, for the large span-batch sizes sharding is meant to help with.
+//
+// This drives both compressors' Write/Flush/Close directly with the same RLP-encoded span
+// batch bytes, rather than going through derive.NewChannelOut: for a SpanBatchType channel,
+// NewChannelOut builds its own internal zlib SpanChannelOut and only ever reads the passed
+// derive.Compressor's TargetOutputSize(), so driving the comparison through it would exercise
+// identical code on both the "Serial" and "Parallel" arms no matter which Compressor was
+// constructed above.
+// Hint: run with -cpu=1,2,4,8 to vary GOMAXPROCS across a single invocation.
+func BenchmarkParallelShadowCompressor(b *testing.B) {
+	type target struct{ bs, tpb int }
+	targets := []target{
+		{100, 100},
+		{1000, 100},
+	}
+
+	chainID := big.NewInt(333)
+	for _, t := range targets {
+		rng := rand.New(rand.NewSource(0x543331))
+		batches := make([]*derive.SingularBatch, t.bs)
+		now := time.Now()
+		for i := 0; i < t.bs; i++ {
+			batches[i] = derive.RandomSingularBatch(rng, t.tpb, chainID)
+			batches[i].Timestamp = uint64(now.Add(time.Duration(i) * time.Second).Unix())
+		}
+
+		spanBatch := derive.NewSpanBatch(uint64(0), chainID)
+		for i, batch := range batches {
+			require.NoError(b, spanBatch.AppendSingularBatch(batch, uint64(i)))
+		}
+		rawSpanBatch, err := spanBatch.ToRawSpanBatch()
+		require.NoError(b, err)
+		var raw bytes.Buffer
+		require.NoError(b, rlp.Encode(&raw, derive.NewBatchData(rawSpanBatch)))
+
+		for _, mode := range []string{"Serial", "Parallel"} {
+			name := fmt.Sprintf("bs=%d,tpb=%d,GOMAXPROCS=%d,%s", t.bs, t.tpb, runtime.GOMAXPROCS(0), mode)
+			b.Run(name, func(b *testing.B) {
+				for bn := 0; bn < b.N; bn++ {
+					b.StopTimer()
+					var comp derive.Compressor
+					var err error
+					if mode == "Serial" {
+						comp, err = compressor.NewShadowCompressor(compressor.Config{TargetOutputSize: 100_000_000_000})
+					} else {
+						comp, err = compressor.NewParallelShadowCompressor(compressor.Config{TargetOutputSize: 100_000_000_000}, runtime.GOMAXPROCS(0))
+					}
+					require.NoError(b, err)
+					b.StartTimer()
+
+					_, err = comp.Write(raw.Bytes())
+					require.NoError(b, err)
+					require.NoError(b, comp.Flush())
+					require.NoError(b, comp.Close())
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkCompressorMatrix runs every {compressor, txPerBatch, batchCount} combination as
+// a nested b.Run, sourcing batches from a RepeatableBatchSource so allocation from
+// regenerating random batches is never counted as compression work, and reports
+// compressed-bytes-per-tx, compression ratio, and bytes/ns for each - directly comparable
+// across compressor implementations straight from `go test -bench` output, without any
+// post-processing.
+//
+// Batches are RLP-encoded once per case and written to each compressor directly, rather
+// than through derive.NewChannelOut: for a SpanBatchType channel, NewChannelOut builds its
+// own internal zlib SpanChannelOut and only reads the passed derive.Compressor's
+// TargetOutputSize(), so every compressor in the matrix would otherwise be measured running
+// identical zlib code instead of the compressor actually named in the benchmark case. That
+// also makes the batchType axis moot - driving a Compressor directly is the same operation
+// regardless of which BatchType the RLP came from - so this only covers span batches, the
+// shape a ChunkedChannelOut/SpanChannelOut-backed batcher actually submits.
+//
+// BlindCompressor and ZstdCompressor are registered in the compressors map with a 100_000_000_000-byte
+// TargetOutputSize, large enough that a single test case's input never crosses it inside
+// Write - every byte is only ever written to the underlying encoder from Close. The reported
+// metrics for those two entries are only meaningful because Close now flushes that pending
+// buffer before closing the encoder; without that fix they would report a near-empty,
+// ratio-skewing output regardless of what this benchmark does.
+func BenchmarkCompressorMatrix(b *testing.B) {
+	type target struct{ bs, tpb int }
+	targets := []target{
+		{10, 1},
+		{100, 1},
+		{100, 100},
+	}
+
+	chainID := big.NewInt(333)
+	for compKey := range compressors {
+		for _, t := range targets {
+			compKey, t := compKey, t
+			rng := rand.New(rand.NewSource(0x543331))
+			source := NewRepeatableBatchSource(rng, chainID, t.bs, t.tpb)
+			txCount := t.bs * t.tpb
+
+			name := fmt.Sprintf("compressor=%s,tpb=%d,bs=%d", compKey, t.tpb, t.bs)
+			b.Run(name, func(b *testing.B) {
+				var totalIn, totalOut int
+				for bn := 0; bn < b.N; bn++ {
+					b.StopTimer()
+					batches := source.Clone()
+					spanBatch := derive.NewSpanBatch(0, chainID)
+					for i, batch := range batches {
+						require.NoError(b, spanBatch.AppendSingularBatch(batch, uint64(i)))
+					}
+					rawSpanBatch, err := spanBatch.ToRawSpanBatch()
+					require.NoError(b, err)
+					var raw bytes.Buffer
+					require.NoError(b, rlp.Encode(&raw, derive.NewBatchData(rawSpanBatch)))
+
+					compressors[compKey].Reset()
+					b.StartTimer()
+
+					_, err = compressors[compKey].Write(raw.Bytes())
+					require.NoError(b, err)
+					require.NoError(b, compressors[compKey].Close())
+
+					totalIn += raw.Len()
+					totalOut += compressors[compKey].Len()
+				}
+				if txCount > 0 && b.N > 0 {
+					b.ReportMetric(float64(totalOut)/float64(b.N)/float64(txCount), "compressed-bytes/tx")
+				}
+				if totalOut > 0 {
+					b.ReportMetric(float64(totalIn)/float64(totalOut), "ratio")
+				}
+				if ns := b.Elapsed().Nanoseconds(); ns > 0 {
+					b.ReportMetric(float64(totalOut)/float64(ns), "bytes/ns")
+				}
+			})
+		}
+	}
+}
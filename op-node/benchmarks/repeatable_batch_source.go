@@ -0,0 +1,45 @@
+package benchmarks
+
+import (
+	"math/big"
+	"math/rand"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+// RepeatableBatchSource pre-generates a deterministic set of SingularBatches once, then
+// hands out a deep copy - including tx byte slices - on every Clone call. Without this,
+// a b.N loop that regenerates random batches inside the timed region conflates allocation
+// with the compression work under test, and a loop that reuses one slice across iterations
+// risks downstream mutation inside AddSingularBatch/span-batch building poisoning later
+// iterations.
+type RepeatableBatchSource struct {
+	batches []*derive.SingularBatch
+}
+
+// NewRepeatableBatchSource pre-generates batchCount random batches of txPerBatch
+// transactions each, for chainID, using rng.
+func NewRepeatableBatchSource(rng *rand.Rand, chainID *big.Int, batchCount, txPerBatch int) *RepeatableBatchSource {
+	batches := make([]*derive.SingularBatch, batchCount)
+	for i := range batches {
+		batches[i] = derive.RandomSingularBatch(rng, txPerBatch, chainID)
+	}
+	return &RepeatableBatchSource{batches: batches}
+}
+
+// Clone returns a deep copy of the pre-generated batches, safe for the caller to mutate
+// without affecting later calls to Clone.
+func (s *RepeatableBatchSource) Clone() []*derive.SingularBatch {
+	out := make([]*derive.SingularBatch, len(s.batches))
+	for i, b := range s.batches {
+		cp := *b
+		cp.Transactions = make([]hexutil.Bytes, len(b.Transactions))
+		for j, tx := range b.Transactions {
+			cp.Transactions[j] = append(hexutil.Bytes(nil), tx...)
+		}
+		out[i] = &cp
+	}
+	return out
+}
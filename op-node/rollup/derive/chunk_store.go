@@ -0,0 +1,72 @@
+package derive
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUChunkStore is a bounded, in-memory ChunkStore. It backs both the batcher's
+// ChunkedChannelOut (so a chunk already sent in one channel can be referenced rather than
+// resent in another) and the derivation side's reference resolution, which needs the same
+// eviction policy to avoid retaining every chunk a node has ever seen.
+type LRUChunkStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[[32]byte]*list.Element
+}
+
+type lruChunkEntry struct {
+	hash [32]byte
+	data []byte
+}
+
+// NewLRUChunkStore creates an LRUChunkStore holding up to capacity chunks.
+func NewLRUChunkStore(capacity int) *LRUChunkStore {
+	return &LRUChunkStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[[32]byte]*list.Element, capacity),
+	}
+}
+
+func (s *LRUChunkStore) Has(hash [32]byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.items[hash]
+	return ok
+}
+
+// Get returns the chunk data previously Put under hash, resolving a reference frame back
+// to its content. The second return value is false if the chunk is unknown, e.g. because
+// it was evicted or was never seen by this store.
+func (s *LRUChunkStore) Get(hash [32]byte) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[hash]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(e)
+	return e.Value.(*lruChunkEntry).data, true
+}
+
+func (s *LRUChunkStore) Put(hash [32]byte, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[hash]; ok {
+		s.ll.MoveToFront(e)
+		return
+	}
+	cp := append([]byte(nil), data...)
+	e := s.ll.PushFront(&lruChunkEntry{hash: hash, data: cp})
+	s.items[hash] = e
+	for s.ll.Len() > s.capacity {
+		oldest := s.ll.Back()
+		if oldest == nil {
+			break
+		}
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruChunkEntry).hash)
+	}
+}
@@ -0,0 +1,461 @@
+package derive
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+)
+
+const (
+	// chunkWindowSize is the size, in bytes, of the sliding window the rolling hash used
+	// for content-defined chunking is computed over.
+	chunkWindowSize = 64
+	// chunkMinSize and chunkMaxSize bound the size of a single chunk: a boundary is never
+	// cut before chunkMinSize bytes, and is always cut by chunkMaxSize bytes.
+	chunkMinSize = 4 * 1024
+	chunkMaxSize = 128 * 1024
+	// chunkMaskBits controls the average chunk size between the min and max bounds: a
+	// boundary is cut whenever the low chunkMaskBits bits of the rolling hash are zero,
+	// which yields an average chunk size of roughly 2^chunkMaskBits bytes.
+	chunkMaskBits = 14 // ~16KiB average
+)
+
+// rollingHash is a Rabin-style polynomial rolling hash over the last chunkWindowSize bytes
+// seen, used to pick content-defined chunk boundaries that are stable under insertions and
+// deletions elsewhere in the stream (unlike fixed-size chunking).
+type rollingHash struct {
+	window [chunkWindowSize]byte
+	pos    int
+	hash   uint64
+}
+
+const rollingBase uint64 = 1000000007
+
+// rollingPow is rollingBase^chunkWindowSize, used to remove the outgoing byte's
+// contribution from the hash. Unsigned overflow is intentional: the hash operates modulo
+// 2^64.
+var rollingPow = func() uint64 {
+	p := uint64(1)
+	for i := 0; i < chunkWindowSize; i++ {
+		p *= rollingBase
+	}
+	return p
+}()
+
+func (r *rollingHash) roll(b byte) uint64 {
+	old := r.window[r.pos]
+	r.window[r.pos] = b
+	r.pos = (r.pos + 1) % chunkWindowSize
+	r.hash = r.hash*rollingBase + uint64(b) - uint64(old)*rollingPow
+	return r.hash
+}
+
+// isChunkBoundary reports whether size bytes into the current chunk, with the rolling
+// hash at the given value, is a valid place to cut a chunk boundary.
+func isChunkBoundary(hash uint64, size int) bool {
+	if size < chunkMinSize {
+		return false
+	}
+	if size >= chunkMaxSize {
+		return true
+	}
+	return hash&(1<<chunkMaskBits-1) == 0
+}
+
+// chunkBytes splits data into content-defined chunks using a rolling hash over
+// chunkWindowSize bytes, cutting a new chunk whenever isChunkBoundary reports true.
+func chunkBytes(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	var chunks [][]byte
+	var rh rollingHash
+	start := 0
+	for i, b := range data {
+		h := rh.roll(b)
+		if isChunkBoundary(h, i-start+1) {
+			chunks = append(chunks, data[start:i+1])
+			start = i + 1
+			rh = rollingHash{}
+		}
+	}
+	if start < len(data) {
+		chunks = append(chunks, data[start:])
+	}
+	return chunks
+}
+
+// ChunkStore is the dedup index ChunkedChannelOut consults: a simple content-hash ->
+// payload cache. A companion LRU-backed implementation on the derivation side lets
+// DecodeChunkedChannel resolve reference frames back to their chunk data. Implementations
+// are expected to be safe for concurrent use, since a batcher runs many channels over its
+// lifetime.
+type ChunkStore interface {
+	Has(hash [32]byte) bool
+	Get(hash [32]byte) ([]byte, bool)
+	Put(hash [32]byte, data []byte)
+}
+
+// chunkFrame is one chunk of a ChunkedChannelOut's payload: either the chunk's compressed
+// bytes, or - if chunkStore already held this chunk's hash - a bare reference to it.
+type chunkFrame struct {
+	hash      [32]byte
+	reference bool
+	data      []byte // compressed chunk bytes; empty when reference is true
+}
+
+// encode writes the chunk's wire form: a 1-byte tag (0 = inline, 1 = reference), the
+// 32-byte content hash, and - for inline chunks only - a 4-byte big-endian length prefix
+// followed by the compressed data. The length prefix is required for DecodeChunkedChannel
+// to find the next frame's boundary; without it a stream of inline chunks is ambiguous.
+func (c chunkFrame) encode(w *bytes.Buffer) {
+	if c.reference {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+	w.Write(c.hash[:])
+	if !c.reference {
+		var lenBuf [4]byte
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(c.data)))
+		w.Write(lenBuf[:])
+		w.Write(c.data)
+	}
+}
+
+// ChunkedChannelOut splits a channel's RLP-encoded batch stream into content-defined
+// chunks before compression (see chunkBytes), compresses each chunk independently, and
+// prefixes it with a stable hash of its uncompressed content. Chunks the chunkStore has
+// already seen are emitted as a 32-byte reference instead of being recompressed and
+// retransmitted, which avoids redundant work across channels that share content - most
+// commonly when the sequencer regenerates a channel's batches after an L1 reorg or a fee
+// spike.
+type ChunkedChannelOut struct {
+	id    ChannelID
+	frame uint64
+
+	algo       CompressionAlgo
+	chunkStore ChunkStore
+
+	// rlp is a double buffer of the channel's RLP-encoded, uncompressed data, following
+	// the same "undo the last change" scheme as SpanChannelOut.
+	rlp      [2]*bytes.Buffer
+	rlpIndex int
+
+	// frames holds the chunk framing built from the active rlp buffer by frameChunks and
+	// installed by setFrames.
+	frames []chunkFrame
+	// out is the concatenation of frames, ready to be read by OutputFrame.
+	out *bytes.Buffer
+
+	target uint64
+	closed bool
+
+	spanBatch *SpanBatch
+}
+
+// NewChunkedChannelOut creates a ChunkedChannelOut. chunkStore is consulted and updated as
+// chunks are produced; share one chunkStore across channels to get cross-channel dedup.
+func NewChunkedChannelOut(genesisTimestamp uint64, chainID *big.Int, targetOutputSize uint64, algo CompressionAlgo, chunkStore ChunkStore) (*ChunkedChannelOut, error) {
+	co := &ChunkedChannelOut{
+		spanBatch:  NewSpanBatch(genesisTimestamp, chainID),
+		rlp:        [2]*bytes.Buffer{{}, {}},
+		out:        &bytes.Buffer{},
+		algo:       algo,
+		chunkStore: chunkStore,
+		target:     targetOutputSize,
+	}
+	if err := co.randomID(); err != nil {
+		return nil, err
+	}
+	return co, nil
+}
+
+func (co *ChunkedChannelOut) ID() ChannelID {
+	return co.id
+}
+
+func (co *ChunkedChannelOut) randomID() error {
+	_, err := rand.Read(co.id[:])
+	return err
+}
+
+func (co *ChunkedChannelOut) activeRLP() *bytes.Buffer {
+	return co.rlp[co.rlpIndex]
+}
+
+func (co *ChunkedChannelOut) switchRLP() {
+	co.rlpIndex = (co.rlpIndex + 1) % 2
+}
+
+func (co *ChunkedChannelOut) Reset() error {
+	co.closed = false
+	co.frame = 0
+	co.rlp[0].Reset()
+	co.rlp[1].Reset()
+	co.frames = nil
+	co.out.Reset()
+	co.spanBatch = NewSpanBatch(co.spanBatch.GenesisTimestamp, co.spanBatch.ChainID)
+	return co.randomID()
+}
+
+func (co *ChunkedChannelOut) AddBlock(rollupCfg *rollup.Config, block *types.Block) (uint64, error) {
+	if co.closed {
+		return 0, ErrChannelOutAlreadyClosed
+	}
+	batch, l1Info, err := BlockToSingularBatch(rollupCfg, block)
+	if err != nil {
+		return 0, err
+	}
+	return co.AddSingularBatch(batch, l1Info.SequenceNumber)
+}
+
+func (co *ChunkedChannelOut) AddSingularBatch(batch *SingularBatch, seqNum uint64) (uint64, error) {
+	if co.closed {
+		return 0, ErrChannelOutAlreadyClosed
+	}
+
+	if err := co.spanBatch.AppendSingularBatch(batch, seqNum); err != nil {
+		return 0, fmt.Errorf("failed to append SingularBatch to SpanBatch: %w", err)
+	}
+	rawSpanBatch, err := co.spanBatch.ToRawSpanBatch()
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert SpanBatch into RawSpanBatch: %w", err)
+	}
+
+	co.switchRLP()
+	co.activeRLP().Reset()
+	if err := rlp.Encode(co.activeRLP(), NewBatchData(rawSpanBatch)); err != nil {
+		return 0, fmt.Errorf("failed to encode RawSpanBatch into bytes: %w", err)
+	}
+	if co.activeRLP().Len() > MaxRLPBytesPerChannel {
+		return 0, fmt.Errorf("could not take %d bytes as replacement of channel, max is %d. err: %w",
+			co.activeRLP().Len(), MaxRLPBytesPerChannel, ErrTooManyRLPBytes)
+	}
+
+	// Probe only: frameChunks(commit=false) must not register chunks in chunkStore here,
+	// since this RLP buffer may still be reverted below if it overshoots target. Chunks are
+	// only ever committed once, from the final buffer, in Close.
+	frames, err := co.frameChunks(co.activeRLP().Bytes(), false)
+	if err != nil {
+		return 0, err
+	}
+	co.setFrames(frames)
+
+	if uint64(co.out.Len()) > co.target {
+		if len(co.spanBatch.Batches) == 1 {
+			co.Close()
+			return uint64(co.out.Len()), nil
+		}
+		// revert to the previous RLP buffer and its framing
+		co.switchRLP()
+		frames, err := co.frameChunks(co.activeRLP().Bytes(), false)
+		if err != nil {
+			return 0, err
+		}
+		co.setFrames(frames)
+		co.Close()
+		return uint64(co.out.Len()), ErrCompressorFull
+	}
+
+	return uint64(co.out.Len()), nil
+}
+
+// frameChunks re-chunks data, compressing each chunk not already present in chunkStore
+// (resolving dedup for the rest into bare references), and returns the resulting
+// chunkFrames. When commit is true, every newly-compressed chunk is registered in
+// chunkStore; when false, chunkStore is only read, never written, so that probing a
+// candidate RLP buffer that may still be discarded can never poison chunkStore with chunks
+// that were never actually part of a closed channel.
+func (co *ChunkedChannelOut) frameChunks(data []byte, commit bool) ([]chunkFrame, error) {
+	chunks := chunkBytes(data)
+	frames := make([]chunkFrame, len(chunks))
+	for i, chunk := range chunks {
+		hash := sha256.Sum256(chunk)
+		if co.chunkStore.Has(hash) {
+			frames[i] = chunkFrame{hash: hash, reference: true}
+			continue
+		}
+		var compressed bytes.Buffer
+		w, err := NewCompressorAlgo(co.algo, &compressed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if commit {
+			co.chunkStore.Put(hash, chunk)
+		}
+		frames[i] = chunkFrame{hash: hash, data: compressed.Bytes()}
+	}
+	return frames, nil
+}
+
+// setFrames replaces co.frames and rebuilds co.out from them.
+func (co *ChunkedChannelOut) setFrames(frames []chunkFrame) {
+	co.frames = frames
+	co.out.Reset()
+	for _, f := range frames {
+		f.encode(co.out)
+	}
+}
+
+// InputBytes returns the total amount of RLP-encoded input bytes reflected in co.out.
+func (co *ChunkedChannelOut) InputBytes() int {
+	return co.activeRLP().Len()
+}
+
+// ReadyBytes returns the total amount of framed bytes ready to be output. Like
+// SpanChannelOut, this is always 0 until the channel is closed.
+func (co *ChunkedChannelOut) ReadyBytes() int {
+	if co.closed {
+		return co.out.Len()
+	}
+	return 0
+}
+
+// Flush is a no-op: ChunkedChannelOut, like SpanChannelOut, does not support early output.
+func (co *ChunkedChannelOut) Flush() error {
+	return nil
+}
+
+func (co *ChunkedChannelOut) FullErr() error {
+	if uint64(co.out.Len()) >= co.target {
+		return ErrCompressorFull
+	}
+	return nil
+}
+
+// Close commits the channel's final framing: this is the only point at which chunks are
+// registered in chunkStore, using the exact chunk sequence produced from the final active
+// RLP buffer, so that a reference frame always points at a chunk a decoder can already
+// resolve - either inline earlier in this same pass, or committed by a prior channel's
+// Close.
+func (co *ChunkedChannelOut) Close() error {
+	if co.closed {
+		return ErrChannelOutAlreadyClosed
+	}
+	frames, err := co.frameChunks(co.activeRLP().Bytes(), true)
+	if err != nil {
+		return err
+	}
+	co.setFrames(frames)
+	co.closed = true
+	return nil
+}
+
+// OutputFrame writes a frame to w with a given max size and returns the frame number. See
+// SpanChannelOut.OutputFrame for the full contract.
+func (co *ChunkedChannelOut) OutputFrame(w *bytes.Buffer, maxSize uint64) (uint16, error) {
+	if maxSize < FrameV0OverHeadSize {
+		return 0, ErrMaxFrameSizeTooSmall
+	}
+
+	f := createEmptyFrame(co.id, co.frame, co.ReadyBytes(), co.closed, maxSize)
+
+	if _, err := io.ReadFull(co.out, f.Data); err != nil {
+		return 0, err
+	}
+
+	if err := f.MarshalBinary(w); err != nil {
+		return 0, err
+	}
+
+	co.frame += 1
+	fn := f.FrameNumber
+	if f.IsLast {
+		return fn, io.EOF
+	}
+	return fn, nil
+}
+
+// DecodeChunkedChannel reverses a ChunkedChannelOut's framing: it walks data frame by
+// frame, decompresses and verifies any inline chunk against its declared hash (storing it
+// in chunkStore so later channels' reference frames can resolve against it), resolves
+// reference frames via chunkStore, and returns the concatenated, decompressed RLP bytes.
+// chunkStore must be the same store (or one fed by the same channels) that produced data,
+// since a reference frame is only resolvable if chunkStore already holds its chunk.
+func DecodeChunkedChannel(algo CompressionAlgo, data []byte, chunkStore ChunkStore) ([]byte, error) {
+	var out bytes.Buffer
+	for len(data) > 0 {
+		if len(data) < 1+32 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		reference := data[0] == 1
+		var hash [32]byte
+		copy(hash[:], data[1:33])
+		data = data[33:]
+
+		if reference {
+			chunk, ok := chunkStore.Get(hash)
+			if !ok {
+				return nil, fmt.Errorf("unresolvable chunk reference %x", hash)
+			}
+			out.Write(chunk)
+			continue
+		}
+
+		if len(data) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		chunkLen := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint64(len(data)) < uint64(chunkLen) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		compressed := data[:chunkLen]
+		data = data[chunkLen:]
+
+		chunk, err := decompressChunk(algo, compressed)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing chunk %x: %w", hash, err)
+		}
+		if sha256.Sum256(chunk) != hash {
+			return nil, fmt.Errorf("chunk %x failed hash verification", hash)
+		}
+		chunkStore.Put(hash, chunk)
+		out.Write(chunk)
+	}
+	return out.Bytes(), nil
+}
+
+// decompressChunk decompresses a single chunk's compressed bytes using algo.
+func decompressChunk(algo CompressionAlgo, compressed []byte) ([]byte, error) {
+	switch algo {
+	case AlgoZlib:
+		r, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case AlgoZstd:
+		r, err := zstd.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case AlgoLZ4:
+		return io.ReadAll(lz4.NewReader(bytes.NewReader(compressed)))
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %d", algo)
+	}
+}
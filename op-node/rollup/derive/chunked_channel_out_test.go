@@ -0,0 +1,68 @@
+package derive
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestChunkBytesDeterministicOnSharedPrefix verifies that two inputs sharing a long common
+// prefix - simulating, e.g., a repeated deposit-heavy batch stream - produce identical
+// leading chunks, which is what lets ChunkedChannelOut dedup them across channels.
+func TestChunkBytesDeterministicOnSharedPrefix(t *testing.T) {
+	prefix := bytes.Repeat([]byte("deposit-heavy-batch-payload-"), 8192) // well over chunkMaxSize
+	a := append(append([]byte(nil), prefix...), []byte("-tail-a")...)
+	b := append(append([]byte(nil), prefix...), []byte("-tail-b")...)
+
+	chunksA := chunkBytes(a)
+	chunksB := chunkBytes(b)
+	require.NotEmpty(t, chunksA)
+	require.NotEmpty(t, chunksB)
+
+	shared := 0
+	for shared < len(chunksA) && shared < len(chunksB) && bytes.Equal(chunksA[shared], chunksB[shared]) {
+		shared++
+	}
+	require.Greater(t, shared, 0, "expected at least one identical leading chunk")
+}
+
+// TestChunkedChannelOutReferenceRoundTrip builds two ChunkedChannelOuts over a shared
+// chunkStore, where the second channel's data shares a long prefix with the first's, so it
+// is expected to emit reference frames for the chunks the first channel already committed.
+// It then decodes both outputs - against a separate decode-side store, as a real node would
+// use - and checks the decoded bytes match the originals.
+func TestChunkedChannelOutReferenceRoundTrip(t *testing.T) {
+	store := NewLRUChunkStore(1024)
+
+	prefix := bytes.Repeat([]byte("span-batch-rlp-payload-"), 8192) // well over chunkMaxSize
+	dataA := append(append([]byte(nil), prefix...), []byte("-channel-a")...)
+	dataB := append(append([]byte(nil), prefix...), []byte("-channel-b")...)
+
+	coA := &ChunkedChannelOut{algo: AlgoZlib, chunkStore: store, out: &bytes.Buffer{}}
+	framesA, err := coA.frameChunks(dataA, true)
+	require.NoError(t, err)
+	coA.setFrames(framesA)
+
+	coB := &ChunkedChannelOut{algo: AlgoZlib, chunkStore: store, out: &bytes.Buffer{}}
+	framesB, err := coB.frameChunks(dataB, true)
+	require.NoError(t, err)
+	coB.setFrames(framesB)
+
+	referenced := 0
+	for _, f := range framesB {
+		if f.reference {
+			referenced++
+		}
+	}
+	require.Greater(t, referenced, 0, "expected channel B to reference at least one chunk already committed by channel A")
+
+	decodeStore := NewLRUChunkStore(1024)
+	outA, err := DecodeChunkedChannel(AlgoZlib, coA.out.Bytes(), decodeStore)
+	require.NoError(t, err)
+	require.Equal(t, dataA, outA)
+
+	outB, err := DecodeChunkedChannel(AlgoZlib, coB.out.Bytes(), decodeStore)
+	require.NoError(t, err)
+	require.Equal(t, dataB, outB)
+}
@@ -0,0 +1,206 @@
+package derive
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// ErrAlgoNotActivated is returned when a CompressionAlgo other than AlgoZlib is requested
+// before the L1 hard fork that activates its on-wire tag byte.
+var ErrAlgoNotActivated = errors.New("compression algorithm not yet activated")
+
+// CompressionAlgo identifies the compression algorithm used to produce a channel's
+// compressed payload. It is written as a single leading tag byte ahead of the compressed
+// data so the derivation pipeline knows which decoder to dispatch to.
+type CompressionAlgo byte
+
+const (
+	// AlgoZlib is the original, zlib/DEFLATE based compression used by every channel
+	// before CompressionAlgo was introduced. It carries no tag byte: the decoder instead
+	// recognizes it from zlib's own magic header, so old channels keep decoding unchanged.
+	AlgoZlib CompressionAlgo = iota
+	// AlgoZstd selects github.com/klauspost/compress/zstd.
+	AlgoZstd
+	// AlgoLZ4 selects github.com/pierrec/lz4/v4.
+	AlgoLZ4
+)
+
+// zlibMagicByte is the first byte of every zlib stream written at BestCompression with a
+// default window size. Channels produced before CompressionAlgo existed all begin with this
+// byte, so detectAlgo uses its absence to know a tag byte was prepended.
+const zlibMagicByte = 0x78
+
+func (a CompressionAlgo) String() string {
+	switch a {
+	case AlgoZlib:
+		return "zlib"
+	case AlgoZstd:
+		return "zstd"
+	case AlgoLZ4:
+		return "lz4"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(a))
+	}
+}
+
+// CompressorAlgo is the minimal writer interface every compression algorithm backing a
+// ChannelOut must implement. It mirrors the subset of compress/zlib.Writer that
+// SpanChannelOut and the op-batcher compressors already depend on, so swapping algorithms
+// requires no change to the surrounding buffering logic.
+type CompressorAlgo interface {
+	io.Writer
+	Flush() error
+	Close() error
+	// Reset discards the writer's state and begins writing to w.
+	Reset(w io.Writer) error
+}
+
+// NewCompressorAlgo constructs the CompressorAlgo for algo, writing into w.
+func NewCompressorAlgo(algo CompressionAlgo, w io.Writer) (CompressorAlgo, error) {
+	switch algo {
+	case AlgoZlib:
+		zw, err := zlib.NewWriterLevel(w, zlib.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		return &zlibAlgo{zw}, nil
+	case AlgoZstd:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdAlgo{zw}, nil
+	case AlgoLZ4:
+		zw := lz4.NewWriter(w)
+		if err := zw.Apply(lz4.CompressionLevelOption(lz4.Level9)); err != nil {
+			return nil, err
+		}
+		return &lz4Algo{zw}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %d", algo)
+	}
+}
+
+// zlibAlgo adapts *zlib.Writer's void Reset to the error-returning CompressorAlgo.Reset.
+type zlibAlgo struct {
+	*zlib.Writer
+}
+
+func (z *zlibAlgo) Reset(w io.Writer) error {
+	z.Writer.Reset(w)
+	return nil
+}
+
+// zstdAlgo adapts *zstd.Encoder's void Reset to the error-returning CompressorAlgo.Reset.
+type zstdAlgo struct {
+	*zstd.Encoder
+}
+
+func (z *zstdAlgo) Reset(w io.Writer) error {
+	z.Encoder.Reset(w)
+	return nil
+}
+
+// lz4Algo adapts *lz4.Writer's void Reset to the error-returning CompressorAlgo.Reset.
+type lz4Algo struct {
+	*lz4.Writer
+}
+
+func (z *lz4Algo) Reset(w io.Writer) error {
+	z.Writer.Reset(w)
+	return nil
+}
+
+// writeAlgoTag prepends the single-byte algorithm tag for non-zlib algorithms. Zlib channels
+// are left untagged so channels already written before this change keep decoding unchanged.
+func writeAlgoTag(buf io.ByteWriter, algo CompressionAlgo) error {
+	if algo == AlgoZlib {
+		return nil
+	}
+	return buf.WriteByte(byte(algo))
+}
+
+// ValidateAlgoActivation returns an error if algo requires a hard fork that has not yet
+// activated at l1BlockTime. AlgoZlib is always allowed, matching channels written before
+// per-channel algorithm selection existed. activationTime follows the rollup.Config
+// convention of a fork time in L1 block-timestamp units (e.g. CanyonTime, DeltaTime); a nil
+// activationTime means algo has no scheduled activation and is always refused.
+func ValidateAlgoActivation(algo CompressionAlgo, l1BlockTime uint64, activationTime *uint64) error {
+	if algo == AlgoZlib {
+		return nil
+	}
+	if activationTime == nil || l1BlockTime < *activationTime {
+		return fmt.Errorf("%w: %s requires a hard fork not yet active at block time %d", ErrAlgoNotActivated, algo, l1BlockTime)
+	}
+	return nil
+}
+
+// detectAlgo inspects the leading byte of a compressed channel payload and returns the
+// CompressionAlgo that produced it, along with the number of leading tag bytes the caller
+// must skip before handing the remainder to that algorithm's decoder.
+func detectAlgo(data []byte) (algo CompressionAlgo, tagLen int, err error) {
+	if len(data) == 0 {
+		return AlgoZlib, 0, io.ErrUnexpectedEOF
+	}
+	if data[0] == zlibMagicByte {
+		return AlgoZlib, 0, nil
+	}
+	switch CompressionAlgo(data[0]) {
+	case AlgoZstd, AlgoLZ4:
+		return CompressionAlgo(data[0]), 1, nil
+	default:
+		return AlgoZlib, 0, fmt.Errorf("cannot determine compression algorithm from leading byte 0x%x", data[0])
+	}
+}
+
+// newDecompressorAlgo constructs the reader for algo, reading compressed bytes from r.
+func newDecompressorAlgo(algo CompressionAlgo, r io.Reader) (io.ReadCloser, error) {
+	switch algo {
+	case AlgoZlib:
+		return zlib.NewReader(r)
+	case AlgoZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case AlgoLZ4:
+		return io.NopCloser(lz4.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %d", algo)
+	}
+}
+
+// DecompressChannel reverses NewCompressorAlgo/writeAlgoTag: it uses detectAlgo to identify
+// which algorithm produced data and how many leading tag bytes to skip, then returns the
+// decompressed payload.
+//
+// This package does not contain ChannelInReader/BatchReader - the derivation-side channel
+// read path lives elsewhere and is not part of this source tree - so DecompressChannel has
+// no caller here yet. Wiring it into that read path's algorithm-dispatch switch, and into
+// the op-batcher CLI flags that would let an operator select a non-zlib algorithm, is
+// deferred until those files are available to edit; until then, a channel written with any
+// algorithm other than AlgoZlib is encodable by SpanChannelOut but not yet decodable by the
+// real derivation pipeline.
+func DecompressChannel(data []byte) ([]byte, error) {
+	algo, tagLen, err := detectAlgo(data)
+	if err != nil {
+		return nil, fmt.Errorf("detecting channel compression algorithm: %w", err)
+	}
+	r, err := newDecompressorAlgo(algo, bytes.NewReader(data[tagLen:]))
+	if err != nil {
+		return nil, fmt.Errorf("constructing %s decompressor: %w", algo, err)
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing %s channel: %w", algo, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,38 @@
+package derive
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestCompressDecompressRoundTrip checks that DecompressChannel reverses
+// NewCompressorAlgo/writeAlgoTag for every CompressionAlgo, using detectAlgo to identify the
+// algorithm from the tagged bytes alone, the same way a decoder reading an arbitrary channel
+// off of L1 would.
+func TestCompressDecompressRoundTrip(t *testing.T) {
+	for _, algo := range []CompressionAlgo{AlgoZlib, AlgoZstd, AlgoLZ4} {
+		algo := algo
+		t.Run(algo.String(), func(t *testing.T) {
+			input := bytes.Repeat([]byte("span batch rlp payload "), 1024)
+
+			var buf bytes.Buffer
+			require.NoError(t, writeAlgoTag(&buf, algo))
+			w, err := NewCompressorAlgo(algo, &buf)
+			require.NoError(t, err)
+			_, err = w.Write(input)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			out, err := DecompressChannel(buf.Bytes())
+			require.NoError(t, err)
+			require.Equal(t, input, out)
+		})
+	}
+}
+
+func TestDecompressChannelEmptyInput(t *testing.T) {
+	_, err := DecompressChannel(nil)
+	require.Error(t, err)
+}
@@ -2,7 +2,6 @@ package derive
 
 import (
 	"bytes"
-	"compress/zlib"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -28,8 +27,11 @@ type SpanChannelOut struct {
 	rlpIndex int
 	// compressed contains compressed data for making output frames
 	compressed *bytes.Buffer
-	// compress is the zlib writer for the channel
-	compressor *zlib.Writer
+	// compressor is the CompressorAlgo backing the channel. Defaults to AlgoZlib.
+	compressor CompressorAlgo
+	// algorithm is the CompressionAlgo compressor implements, recorded so Reset can
+	// rebuild an equivalent compressor and so the compressed payload can be tagged.
+	algorithm CompressionAlgo
 	// target is the target size of the compressed data
 	target uint64
 	// closed indicates if the channel is closed
@@ -50,7 +52,18 @@ func (co *SpanChannelOut) randomID() error {
 	return nil
 }
 
+// NewSpanChannelOut creates a SpanChannelOut that compresses with AlgoZlib, matching the
+// channel framing every op-node derivation pipeline has always accepted. Use
+// NewSpanChannelOutWithAlgo to opt into zstd or lz4 framing.
 func NewSpanChannelOut(genesisTimestamp uint64, chainID *big.Int, targetOutputSize uint64) (*SpanChannelOut, error) {
+	return NewSpanChannelOutWithAlgo(genesisTimestamp, chainID, targetOutputSize, AlgoZlib)
+}
+
+// NewSpanChannelOutWithAlgo creates a SpanChannelOut that compresses with the given
+// CompressionAlgo. Non-zlib channels are tagged with a leading algorithm byte so the
+// derivation pipeline can dispatch to the matching decoder; zlib channels are left
+// untagged for backwards compatibility with channels written before this option existed.
+func NewSpanChannelOutWithAlgo(genesisTimestamp uint64, chainID *big.Int, targetOutputSize uint64, algo CompressionAlgo) (*SpanChannelOut, error) {
 	c := &SpanChannelOut{
 		id:         ChannelID{},
 		frame:      0,
@@ -58,17 +71,31 @@ func NewSpanChannelOut(genesisTimestamp uint64, chainID *big.Int, targetOutputSi
 		rlp:        [2]*bytes.Buffer{{}, {}},
 		compressed: &bytes.Buffer{},
 		target:     targetOutputSize,
+		algorithm:  algo,
 	}
 	var err error
 	if err = c.randomID(); err != nil {
 		return nil, err
 	}
-	if c.compressor, err = zlib.NewWriterLevel(c.compressed, zlib.BestCompression); err != nil {
+	if c.compressor, err = NewCompressorAlgo(algo, c.compressed); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+// NewSpanChannelOutWithAlgoActivation is like NewSpanChannelOutWithAlgo, but additionally
+// enforces that non-zlib algorithms are refused until their L1 hard fork has activated as
+// of l1BlockTime; see ValidateAlgoActivation. The batcher should call this instead of
+// NewSpanChannelOutWithAlgo whenever algo comes from configuration rather than being
+// hardcoded to AlgoZlib, so a misconfigured batcher cannot produce channels op-node
+// instances running an older binary are unable to decode.
+func NewSpanChannelOutWithAlgoActivation(genesisTimestamp uint64, chainID *big.Int, targetOutputSize uint64, algo CompressionAlgo, l1BlockTime uint64, activationTime *uint64) (*SpanChannelOut, error) {
+	if err := ValidateAlgoActivation(algo, l1BlockTime, activationTime); err != nil {
+		return nil, err
+	}
+	return NewSpanChannelOutWithAlgo(genesisTimestamp, chainID, targetOutputSize, algo)
+}
+
 func (co *SpanChannelOut) Reset() error {
 	co.closed = false
 	co.frame = 0
@@ -76,9 +103,11 @@ func (co *SpanChannelOut) Reset() error {
 	co.rlp[1].Reset()
 	co.lastCompressedRLPSize = 0
 	co.compressed.Reset()
-	co.compressor.Reset(co.compressed)
+	if err := co.compressor.Reset(co.compressed); err != nil {
+		return err
+	}
 	co.spanBatch = NewSpanBatch(co.spanBatch.GenesisTimestamp, co.spanBatch.ChainID)
-	// setting the new randomID is the only part of the reset that can fail
+	// setting the new randomID is the only other part of the reset that can fail
 	return co.randomID()
 }
 
@@ -176,6 +205,9 @@ func (co *SpanChannelOut) freshCompress() {
 	co.compressed.Reset()
 	//fmt.Println("after reset", co.compressed.Len())
 	co.compressor.Reset(co.compressed)
+	// tag the payload with its algorithm before any compressed bytes are written, so
+	// the derivation pipeline can dispatch on it without buffering the whole frame first
+	writeAlgoTag(co.compressed, co.algorithm)
 	//fmt.Println("active rlp len", co.activeRLP().Len())
 	co.compressor.Write(co.activeRLP().Bytes())
 	co.compressor.Flush()
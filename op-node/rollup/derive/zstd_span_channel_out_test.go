@@ -0,0 +1,76 @@
+package derive
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestZstdCheckpointResetToFlushes verifies that resetTo's compressed buffer reflects all
+// of data immediately, with no bytes left buffered inside the encoder's internal window -
+// which would otherwise make compressed.Len() under-report size until the next Write/Flush.
+func TestZstdCheckpointResetToFlushes(t *testing.T) {
+	cp, err := newZstdCheckpoint(0)
+	require.NoError(t, err)
+
+	data := []byte("some span batch rlp bytes to compress")
+	require.NoError(t, cp.resetTo(data))
+
+	flushedLen := cp.compressed.Len()
+	require.Greater(t, flushedLen, 0)
+
+	// A further Flush with nothing new written must not grow the buffer: if resetTo's own
+	// Flush had been skipped, this Flush would be the one that finally emits the bytes,
+	// which is exactly the bug this test guards against.
+	require.NoError(t, cp.enc.Flush())
+	require.Equal(t, flushedLen, cp.compressed.Len())
+}
+
+// TestZstdSpanChannelOutTagsOutput verifies a ZstdSpanChannelOut's compressed output carries
+// the AlgoZstd tag byte ahead of the zstd stream, the same way SpanChannelOut tags its own
+// output, so detectAlgo recognizes it instead of choking on zstd's raw magic bytes - and that
+// DecompressChannel can decode it end to end.
+func TestZstdSpanChannelOutTagsOutput(t *testing.T) {
+	chainID := big.NewInt(1234)
+	co, err := NewZstdSpanChannelOut(0, chainID, 100_000, 0)
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(2))
+	input := RandomSingularBatch(rng, 10, chainID)
+	_, err = co.AddSingularBatch(input, 0)
+	require.NoError(t, err)
+	require.NoError(t, co.Close())
+
+	algo, tagLen, err := detectAlgo(co.a.compressed.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, AlgoZstd, algo)
+	require.Equal(t, 1, tagLen)
+
+	_, err = DecompressChannel(co.a.compressed.Bytes())
+	require.NoError(t, err)
+}
+
+// TestZstdSpanChannelOutHeaderChangeStillEnforcesTarget exercises the non-incremental
+// fallback path (a SpanBatch RLP re-encode whose header length changes, so appendsCleanly
+// is false) across many batches, and checks the closed channel's output stays within a
+// quarter of target above it, rather than silently overshooting it further because an
+// intermediate checkpoint's compressed.Len() under-reported its true size.
+func TestZstdSpanChannelOutHeaderChangeStillEnforcesTarget(t *testing.T) {
+	const target = 4096
+	chainID := big.NewInt(1234)
+	co, err := NewZstdSpanChannelOut(0, chainID, target, 0)
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 256; i++ {
+		batch := RandomSingularBatch(rng, 10, chainID)
+		if _, err := co.AddSingularBatch(batch, uint64(i)); err != nil {
+			require.ErrorIs(t, err, ErrCompressorFull)
+			break
+		}
+	}
+	require.True(t, co.closed)
+	require.LessOrEqual(t, co.a.compressed.Len(), int(target)+target/4, "channel overshot its target well beyond normal slack")
+}